@@ -49,6 +49,7 @@ const (
 
 	RuntimeTypeDocker     = "docker"
 	RuntimeTypeContainerd = "containerd"
+	RuntimeTypeCrio       = "cri-o"
 	RuntimeTypeUnknown    = "unknown"
 )
 
@@ -66,6 +67,13 @@ type Formatter struct {
 
 	PodIDParser       func(basename string) (string, error)
 	ContainerIDParser func(basename string) (string, error)
+
+	// ResourceCodec returns the file path and value parser/formatter for the given
+	// resource, e.g. "cpu/cpu.cfs_quota_us" with a plain-integer codec on cgroup v1,
+	// versus "cpu.max" with a codec that knows quota and period share one line on
+	// cgroup v2. It lets callers read/write a resource without knowing which cgroup
+	// version the node runs.
+	ResourceCodec func(resourceType ResourceType) (ResourceCodec, error)
 }
 
 var cgroupPathFormatterInSystemd = Formatter{
@@ -104,6 +112,8 @@ var cgroupPathFormatterInSystemd = Formatter{
 			return RuntimeTypeDocker, fmt.Sprintf("docker-%s.scope", hashID[1]), nil
 		case RuntimeTypeContainerd:
 			return RuntimeTypeContainerd, fmt.Sprintf("cri-containerd-%s.scope", hashID[1]), nil
+		case RuntimeTypeCrio:
+			return RuntimeTypeCrio, fmt.Sprintf("crio-%s.scope", hashID[1]), nil
 		default:
 			return RuntimeTypeUnknown, "", fmt.Errorf("unknown container protocol %s", id)
 		}
@@ -148,6 +158,10 @@ var cgroupPathFormatterInSystemd = Formatter{
 				prefix: "cri-containerd-",
 				suffix: ".scope",
 			},
+			{
+				prefix: "crio-",
+				suffix: ".scope",
+			},
 		}
 
 		for i := range patterns {
@@ -157,8 +171,14 @@ var cgroupPathFormatterInSystemd = Formatter{
 		}
 		return "", fmt.Errorf("fail to parse pod id: %v", basename)
 	},
+	ResourceCodec: resourceCodecV1,
 }
 
+// cgroupPathFormatterInSystemdV2 is the systemd-driven formatter for cgroup v2
+// unified hierarchy nodes. The pod/container directory layout under
+// kubepods.slice/ is unchanged from v1; only the controller file names differ.
+var cgroupPathFormatterInSystemdV2 = newV2Formatter(cgroupPathFormatterInSystemd)
+
 var cgroupPathFormatterInCgroupfs = Formatter{
 	ParentDir: KubeRootNameCgroupfs,
 	QOSDirFn: func(qos corev1.PodQOSClass) string {
@@ -184,6 +204,8 @@ var cgroupPathFormatterInCgroupfs = Formatter{
 			return RuntimeTypeDocker, fmt.Sprintf("%s", hashID[1]), nil
 		} else if hashID[0] == RuntimeTypeContainerd {
 			return RuntimeTypeContainerd, fmt.Sprintf("%s", hashID[1]), nil
+		} else if hashID[0] == RuntimeTypeCrio {
+			return RuntimeTypeCrio, fmt.Sprintf("%s", hashID[1]), nil
 		} else {
 			return RuntimeTypeUnknown, "", fmt.Errorf("unknown container protocol %s", id)
 		}
@@ -197,46 +219,109 @@ var cgroupPathFormatterInCgroupfs = Formatter{
 	ContainerIDParser: func(basename string) (string, error) {
 		return basename, nil
 	},
+	ResourceCodec: resourceCodecV1,
+}
+
+// cgroupPathFormatterInCgroupfsV2 is the cgroupfs-driven formatter for cgroup
+// v2 unified hierarchy nodes.
+var cgroupPathFormatterInCgroupfsV2 = newV2Formatter(cgroupPathFormatterInCgroupfs)
+
+// newV2Formatter derives a cgroup v2 formatter from its v1 counterpart,
+// keeping the same pod/container directory layout but swapping in the v2
+// controller file names.
+func newV2Formatter(v1 Formatter) Formatter {
+	v2 := v1
+	v2.ResourceCodec = resourceCodecV2
+	return v2
+}
+
+func resourceCodecV1(resourceType ResourceType) (ResourceCodec, error) {
+	codec, ok := resourceCodecsV1[resourceType]
+	if !ok {
+		return ResourceCodec{}, fmt.Errorf("unsupported resource type on cgroup v1: %v", resourceType)
+	}
+	return codec, nil
+}
+
+func resourceCodecV2(resourceType ResourceType) (ResourceCodec, error) {
+	codec, ok := resourceCodecsV2[resourceType]
+	if !ok {
+		return ResourceCodec{}, fmt.Errorf("unsupported resource type on cgroup v2: %v", resourceType)
+	}
+	return codec, nil
 }
 
 // CgroupPathFormatter is the cgroup driver formatter.
 // It is initialized with a fastly looked-up type and will be slowly detected with the kubelet when the daemon starts.
 var CgroupPathFormatter = GetCgroupFormatter()
 
-// GetCgroupFormatter gets the cgroup formatter simply looking up the cgroup directory names.
-func GetCgroupFormatter() Formatter {
+// GetCgroupFormatter gets the cgroup formatter simply looking up the cgroup directory names and
+// the cgroup version of the node, then adapts it to a nested kubepods layout (kind, k3s,
+// systemd-in-container) if one is discovered.
+func GetCgroupFormatter(opts ...Option) Formatter {
 	nodeName := os.Getenv("NODE_NAME")
+	version := GetCgroupVersion()
+	o := newFormatterOptions(opts...)
+
 	// setup cgroup path formatter from cgroup driver type
 	driver := GuessCgroupDriverFromCgroupName()
+	var formatter Formatter
 	if driver.Validate() {
-		klog.Infof("Node %s use '%s' as cgroup driver guessed with the cgroup name", nodeName, string(driver))
-		return GetCgroupPathFormatter(driver)
+		klog.Infof("Node %s use '%s' as cgroup driver guessed with the cgroup name, cgroup version '%s'", nodeName, string(driver), string(version))
+		formatter = GetCgroupPathFormatterWithVersion(driver, version)
+	} else {
+		klog.V(4).Infof("can not guess cgroup driver from 'kubepods' cgroup name")
+		if version == CgroupVersionV2 {
+			formatter = cgroupPathFormatterInSystemdV2
+		} else {
+			formatter = cgroupPathFormatterInSystemd
+		}
 	}
-	klog.V(4).Infof("can not guess cgroup driver from 'kubepods' cgroup name")
-	return cgroupPathFormatterInSystemd
+	return detectAndApplyRoot(formatter, o)
 }
 
-// DetectCgroupDriver gets the cgroup driver both from the cgroup directory names and kubelet configs. Check kubelet
-// config can be slow, so it should be called infrequently.
+// DetectCgroupDriver gets the cgroup driver, preferring the CRI runtime, then the cgroup
+// directory names, then the kubelet config, falling back to the default when none apply.
+// Checking the kubelet can take up to 60s, so it is only consulted once the cheaper signals
+// have failed to produce an answer; it should still be called infrequently.
 func DetectCgroupDriver() CgroupDriverType {
+	driver, _ := DetectCgroupDriverWithSource()
+	return driver
+}
+
+// DetectCgroupDriverWithSource is like DetectCgroupDriver but also reports which signal the
+// decision came from, so callers can log it.
+func DetectCgroupDriverWithSource() (CgroupDriverType, DriverDetectionSource) {
 	klog.Infoln("start to get cgroup driver formatter...")
 	nodeName := os.Getenv("NODE_NAME")
-	// guess cgroup driver from cgroup directory names
-	driver := GuessCgroupDriverFromCgroupName()
-	if driver.Validate() {
+
+	// the CRI runtime is the authoritative source: it is what actually creates the cgroups.
+	// it fails fast (a stat of each configured socket) when no CRI endpoint is reachable.
+	if driver, err := DetectCgroupDriverFromCRI(); err == nil {
+		klog.Infof("Node %s use '%s' as cgroup driver according to the CRI runtime", nodeName, string(driver))
+		return driver, DriverDetectedByRuntime
+	} else {
+		klog.V(4).Infof("can not detect cgroup driver from the CRI runtime, err: %v", err)
+	}
+
+	// guess cgroup driver from cgroup directory names; also fast, and usually reliable.
+	if driver := GuessCgroupDriverFromCgroupName(); driver.Validate() {
 		klog.Infof("Node %s use '%s' as cgroup driver according to the cgroup name", nodeName, string(driver))
-		return driver
+		return driver, DriverDetectedByDirName
 	}
 	klog.Infof("can not detect cgroup driver from 'kubepods' cgroup name")
 
-	// guess cgroup driver from the kubelet; it may take at most 60s
-	driver, err := DetectCgroupDriverFromKubelet(nodeName)
-	if err == nil {
+	// guess cgroup driver from the kubelet; it may take at most 60s, so it is the last resort
+	// before falling back to the default.
+	if driver, err := DetectCgroupDriverFromKubelet(nodeName); err == nil {
 		klog.Infof("Node %s use '%s' as cgroup driver according to the kubelet config", nodeName, string(driver))
-		return driver
+		return driver, DriverDetectedByKubelet
+	} else {
+		klog.Infof("can not detect cgroup driver from kubelet, err: %v", err)
 	}
-	klog.Errorf("can not detect cgroup driver from kubelet, use the default, err: %v", err)
-	return Systemd
+
+	klog.Errorf("can not detect cgroup driver from any source, use the default")
+	return Systemd, DriverDetectedByDefault
 }
 
 func DetectCgroupDriverFromKubelet(nodeName string) (CgroupDriverType, error) {
@@ -270,10 +355,22 @@ func DetectCgroupDriverFromKubelet(nodeName string) (CgroupDriverType, error) {
 }
 
 func GetCgroupPathFormatter(driver CgroupDriverType) Formatter {
+	return GetCgroupPathFormatterWithVersion(driver, GetCgroupVersion())
+}
+
+// GetCgroupPathFormatterWithVersion returns the formatter for the given cgroup driver and
+// cgroup version combination.
+func GetCgroupPathFormatterWithVersion(driver CgroupDriverType, version CgroupVersion) Formatter {
 	switch driver {
 	case Systemd:
+		if version == CgroupVersionV2 {
+			return cgroupPathFormatterInSystemdV2
+		}
 		return cgroupPathFormatterInSystemd
 	case Cgroupfs:
+		if version == CgroupVersionV2 {
+			return cgroupPathFormatterInCgroupfsV2
+		}
 		return cgroupPathFormatterInCgroupfs
 	default:
 		klog.Warningf("cgroup driver formatter not supported: '%s'", string(driver))
@@ -282,11 +379,25 @@ func GetCgroupPathFormatter(driver CgroupDriverType) Formatter {
 }
 
 func SetupCgroupPathFormatter(driver CgroupDriverType) {
+	SetupCgroupPathFormatterWithVersion(driver, GetCgroupVersion())
+}
+
+// SetupCgroupPathFormatterWithVersion sets the global CgroupPathFormatter for the given
+// cgroup driver and cgroup version combination.
+func SetupCgroupPathFormatterWithVersion(driver CgroupDriverType, version CgroupVersion) {
 	switch driver {
 	case Systemd:
-		CgroupPathFormatter = cgroupPathFormatterInSystemd
+		if version == CgroupVersionV2 {
+			CgroupPathFormatter = cgroupPathFormatterInSystemdV2
+		} else {
+			CgroupPathFormatter = cgroupPathFormatterInSystemd
+		}
 	case Cgroupfs:
-		CgroupPathFormatter = cgroupPathFormatterInCgroupfs
+		if version == CgroupVersionV2 {
+			CgroupPathFormatter = cgroupPathFormatterInCgroupfsV2
+		} else {
+			CgroupPathFormatter = cgroupPathFormatterInCgroupfs
+		}
 	default:
 		klog.Warningf("cgroup driver formatter not supported: '%s'", string(driver))
 	}
@@ -0,0 +1,216 @@
+/*
+Copyright 2022 The Koordinator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog/v2"
+)
+
+// DriverDetectionSource records which signal DetectCgroupDriver ultimately trusted,
+// for logging and troubleshooting.
+type DriverDetectionSource string
+
+const (
+	DriverDetectedByRuntime DriverDetectionSource = "runtime"
+	DriverDetectedByKubelet DriverDetectionSource = "kubelet"
+	DriverDetectedByDirName DriverDetectionSource = "dir-name"
+	DriverDetectedByDefault DriverDetectionSource = "default"
+)
+
+// defaultCRISocketPaths are the well-known CRI endpoints tried in order when no
+// socket path is configured. They are overridden by the --cri-runtime-socket-paths
+// flag registered below.
+var defaultCRISocketPaths = []string{
+	"/run/containerd/containerd.sock",
+	"/var/run/crio/crio.sock",
+	"/var/run/dockershim.sock",
+}
+
+var criSocketPaths = defaultCRISocketPaths
+
+// SetCRISocketPaths overrides the list of CRI endpoints DetectCgroupDriverFromCRI tries,
+// in priority order.
+func SetCRISocketPaths(paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	criSocketPaths = paths
+}
+
+// criSocketPathsFlag adapts SetCRISocketPaths to flag.Value so --cri-runtime-socket-paths
+// takes effect as soon as the koordlet binary parses its flags.
+type criSocketPathsFlag struct{}
+
+func (criSocketPathsFlag) String() string {
+	return strings.Join(criSocketPaths, ",")
+}
+
+func (criSocketPathsFlag) Set(value string) error {
+	SetCRISocketPaths(strings.Split(value, ","))
+	return nil
+}
+
+func init() {
+	flag.Var(criSocketPathsFlag{}, "cri-runtime-socket-paths",
+		"Comma-separated list of CRI runtime socket paths to probe, in priority order, for cgroup driver detection.")
+}
+
+// DetectCgroupDriverFromCRI asks the CRI runtime which cgroup driver it is configured
+// with, trying each configured socket in order until one answers. It is the most
+// authoritative signal since the runtime is what actually creates cgroups for containers.
+func DetectCgroupDriverFromCRI() (CgroupDriverType, error) {
+	var lastErr error
+	for _, socketPath := range criSocketPaths {
+		if _, err := os.Stat(socketPath); err != nil {
+			continue
+		}
+		driver, err := detectCgroupDriverFromCRISocket(socketPath)
+		if err != nil {
+			lastErr = err
+			klog.V(4).Infof("failed to detect cgroup driver from CRI socket %s, err: %v", socketPath, err)
+			continue
+		}
+		return driver, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no reachable CRI socket among %v", criSocketPaths)
+	}
+	return "", lastErr
+}
+
+func detectCgroupDriverFromCRISocket(socketPath string) (CgroupDriverType, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, "unix://"+socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	if err != nil {
+		return "", fmt.Errorf("failed to dial CRI socket %s: %v", socketPath, err)
+	}
+	defer conn.Close()
+
+	client := runtimeapi.NewRuntimeServiceClient(conn)
+	resp, err := client.Status(ctx, &runtimeapi.StatusRequest{Verbose: true})
+	if err != nil {
+		return "", fmt.Errorf("failed to get status from CRI socket %s: %v", socketPath, err)
+	}
+
+	if driver, ok := parseCgroupDriverFromCRIStatusInfo(resp.GetInfo()); ok {
+		return driver, nil
+	}
+
+	// containerd and CRI-O don't always surface the cgroup driver in Status().Info,
+	// so fall back to reading their well-known config files on the same host.
+	switch {
+	case strings.Contains(socketPath, "containerd"):
+		return detectCgroupDriverFromContainerdConfig("/etc/containerd/config.toml")
+	case strings.Contains(socketPath, "crio"):
+		return detectCgroupDriverFromCrioConfig("/etc/crio/crio.conf")
+	default:
+		return "", fmt.Errorf("CRI socket %s did not report a cgroup driver", socketPath)
+	}
+}
+
+// parseCgroupDriverFromCRIStatusInfo looks for a "SystemdCgroup"/"cgroup_manager" field in
+// the runtime's free-form Status().Info map, as populated by containerd's CRI plugin config
+// dump and CRI-O's /info endpoint.
+func parseCgroupDriverFromCRIStatusInfo(info map[string]string) (CgroupDriverType, bool) {
+	for _, raw := range info {
+		var parsed map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+			continue
+		}
+		if driver, ok := lookupCgroupDriverField(parsed); ok {
+			return driver, true
+		}
+	}
+	return "", false
+}
+
+func lookupCgroupDriverField(m map[string]interface{}) (CgroupDriverType, bool) {
+	if v, ok := m["SystemdCgroup"]; ok {
+		if systemd, ok := v.(bool); ok {
+			if systemd {
+				return Systemd, true
+			}
+			return Cgroupfs, true
+		}
+	}
+	if v, ok := m["cgroup_manager"]; ok {
+		if manager, ok := v.(string); ok {
+			if manager == "systemd" {
+				return Systemd, true
+			}
+			return Cgroupfs, true
+		}
+	}
+	for _, v := range m {
+		if nested, ok := v.(map[string]interface{}); ok {
+			if driver, ok := lookupCgroupDriverField(nested); ok {
+				return driver, true
+			}
+		}
+	}
+	return "", false
+}
+
+// detectCgroupDriverFromContainerdConfig reads containerd's config.toml for the
+// `SystemdCgroup = true` setting under the runc runtime options.
+func detectCgroupDriverFromContainerdConfig(path string) (CgroupDriverType, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read containerd config %s: %v", path, err)
+	}
+	if strings.Contains(string(content), "SystemdCgroup = true") {
+		return Systemd, nil
+	}
+	if strings.Contains(string(content), "SystemdCgroup = false") {
+		return Cgroupfs, nil
+	}
+	return "", fmt.Errorf("containerd config %s does not set SystemdCgroup", path)
+}
+
+// detectCgroupDriverFromCrioConfig reads CRI-O's crio.conf for the `cgroup_manager` field.
+func detectCgroupDriverFromCrioConfig(path string) (CgroupDriverType, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read crio config %s: %v", path, err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "cgroup_manager") {
+			continue
+		}
+		if strings.Contains(line, "systemd") {
+			return Systemd, nil
+		}
+		if strings.Contains(line, "cgroupfs") {
+			return Cgroupfs, nil
+		}
+	}
+	return "", fmt.Errorf("crio config %s does not set cgroup_manager", path)
+}
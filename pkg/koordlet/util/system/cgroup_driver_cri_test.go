@@ -0,0 +1,173 @@
+/*
+Copyright 2022 The Koordinator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseCgroupDriverFromCRIStatusInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		info       map[string]string
+		wantDriver CgroupDriverType
+		wantOK     bool
+	}{
+		{
+			name:       "containerd config dump with SystemdCgroup true",
+			info:       map[string]string{"config": `{"containerd":{"runtimes":{"runc":{"options":{"SystemdCgroup":true}}}}}`},
+			wantDriver: Systemd,
+			wantOK:     true,
+		},
+		{
+			name:       "containerd config dump with SystemdCgroup false",
+			info:       map[string]string{"config": `{"containerd":{"runtimes":{"runc":{"options":{"SystemdCgroup":false}}}}}`},
+			wantDriver: Cgroupfs,
+			wantOK:     true,
+		},
+		{
+			name:       "crio info with cgroup_manager systemd",
+			info:       map[string]string{"info": `{"cgroup_manager":"systemd"}`},
+			wantDriver: Systemd,
+			wantOK:     true,
+		},
+		{
+			name:       "crio info with cgroup_manager cgroupfs",
+			info:       map[string]string{"info": `{"cgroup_manager":"cgroupfs"}`},
+			wantDriver: Cgroupfs,
+			wantOK:     true,
+		},
+		{
+			name:   "no recognisable field",
+			info:   map[string]string{"status": `{"conditions":[]}`},
+			wantOK: false,
+		},
+		{
+			name:   "not json",
+			info:   map[string]string{"status": `not-json`},
+			wantOK: false,
+		},
+		{
+			name:   "empty info",
+			info:   map[string]string{},
+			wantOK: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver, ok := parseCgroupDriverFromCRIStatusInfo(tt.info)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.wantDriver, driver)
+			}
+		})
+	}
+}
+
+func Test_detectCgroupDriverFromContainerdConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    CgroupDriverType
+		wantErr bool
+	}{
+		{
+			name:    "systemd cgroup",
+			content: "[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.runc.options]\n  SystemdCgroup = true\n",
+			want:    Systemd,
+		},
+		{
+			name:    "cgroupfs cgroup",
+			content: "[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.runc.options]\n  SystemdCgroup = false\n",
+			want:    Cgroupfs,
+		},
+		{
+			name:    "no setting",
+			content: "[plugins.\"io.containerd.grpc.v1.cri\"]\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config.toml")
+			assert.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+
+			got, err := detectCgroupDriverFromContainerdConfig(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_detectCgroupDriverFromCrioConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    CgroupDriverType
+		wantErr bool
+	}{
+		{
+			name:    "systemd manager",
+			content: "[crio.runtime]\ncgroup_manager = \"systemd\"\n",
+			want:    Systemd,
+		},
+		{
+			name:    "cgroupfs manager",
+			content: "[crio.runtime]\ncgroup_manager = \"cgroupfs\"\n",
+			want:    Cgroupfs,
+		},
+		{
+			name:    "no setting",
+			content: "[crio.runtime]\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "crio.conf")
+			assert.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+
+			got, err := detectCgroupDriverFromCrioConfig(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_criSocketPathsFlag(t *testing.T) {
+	original := criSocketPaths
+	defer func() { criSocketPaths = original }()
+
+	f := criSocketPathsFlag{}
+	assert.NoError(t, f.Set("/tmp/a.sock,/tmp/b.sock"))
+	assert.Equal(t, []string{"/tmp/a.sock", "/tmp/b.sock"}, criSocketPaths)
+	assert.Equal(t, "/tmp/a.sock,/tmp/b.sock", f.String())
+}
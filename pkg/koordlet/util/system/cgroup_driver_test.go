@@ -0,0 +1,159 @@
+/*
+Copyright 2022 The Koordinator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Formatter_ContainerDirFn(t *testing.T) {
+	tests := []struct {
+		name        string
+		formatter   Formatter
+		containerID string
+		wantRuntime string
+		wantDirName string
+		wantErr     bool
+	}{
+		{
+			name:        "systemd docker",
+			formatter:   cgroupPathFormatterInSystemd,
+			containerID: "docker://0123456789ab",
+			wantRuntime: RuntimeTypeDocker,
+			wantDirName: "docker-0123456789ab.scope",
+		},
+		{
+			name:        "systemd containerd",
+			formatter:   cgroupPathFormatterInSystemd,
+			containerID: "containerd://0123456789ab",
+			wantRuntime: RuntimeTypeContainerd,
+			wantDirName: "cri-containerd-0123456789ab.scope",
+		},
+		{
+			name:        "systemd cri-o",
+			formatter:   cgroupPathFormatterInSystemd,
+			containerID: "cri-o://0123456789ab",
+			wantRuntime: RuntimeTypeCrio,
+			wantDirName: "crio-0123456789ab.scope",
+		},
+		{
+			name:        "cgroupfs docker",
+			formatter:   cgroupPathFormatterInCgroupfs,
+			containerID: "docker://0123456789ab",
+			wantRuntime: RuntimeTypeDocker,
+			wantDirName: "0123456789ab",
+		},
+		{
+			name:        "cgroupfs containerd",
+			formatter:   cgroupPathFormatterInCgroupfs,
+			containerID: "containerd://0123456789ab",
+			wantRuntime: RuntimeTypeContainerd,
+			wantDirName: "0123456789ab",
+		},
+		{
+			name:        "cgroupfs cri-o",
+			formatter:   cgroupPathFormatterInCgroupfs,
+			containerID: "cri-o://0123456789ab",
+			wantRuntime: RuntimeTypeCrio,
+			wantDirName: "0123456789ab",
+		},
+		{
+			name:        "unknown runtime",
+			formatter:   cgroupPathFormatterInSystemd,
+			containerID: "rkt://0123456789ab",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRuntime, gotDirName, err := tt.formatter.ContainerDirFn(tt.containerID)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRuntime, gotRuntime)
+			assert.Equal(t, tt.wantDirName, gotDirName)
+		})
+	}
+}
+
+func Test_Formatter_ContainerIDParser(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter Formatter
+		basename  string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "systemd docker",
+			formatter: cgroupPathFormatterInSystemd,
+			basename:  "docker-0123456789ab.scope",
+			want:      "0123456789ab",
+		},
+		{
+			name:      "systemd containerd",
+			formatter: cgroupPathFormatterInSystemd,
+			basename:  "cri-containerd-0123456789ab.scope",
+			want:      "0123456789ab",
+		},
+		{
+			name:      "systemd cri-o",
+			formatter: cgroupPathFormatterInSystemd,
+			basename:  "crio-0123456789ab.scope",
+			want:      "0123456789ab",
+		},
+		{
+			name:      "cgroupfs docker",
+			formatter: cgroupPathFormatterInCgroupfs,
+			basename:  "0123456789ab",
+			want:      "0123456789ab",
+		},
+		{
+			name:      "cgroupfs containerd",
+			formatter: cgroupPathFormatterInCgroupfs,
+			basename:  "0123456789ab",
+			want:      "0123456789ab",
+		},
+		{
+			name:      "cgroupfs cri-o",
+			formatter: cgroupPathFormatterInCgroupfs,
+			basename:  "0123456789ab",
+			want:      "0123456789ab",
+		},
+		{
+			name:      "systemd unrecognised",
+			formatter: cgroupPathFormatterInSystemd,
+			basename:  "rkt-0123456789ab.scope",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.formatter.ContainerIDParser(tt.basename)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2022 The Koordinator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ErrNotAKubernetesPod is returned by ResolvePIDCgroup when the given PID's cgroup does not
+// live under the kubepods hierarchy, e.g. it belongs to a host-level process.
+var ErrNotAKubernetesPod = errors.New("pid does not belong to a kubernetes pod cgroup")
+
+// ResolvePIDCgroup resolves the pod UID, container ID and QoS class owning the given host PID
+// by reading /proc/<pid>/cgroup. It supports both cgroup v1 and v2, the systemd and cgroupfs
+// drivers, all three runtimes (docker, containerd, cri-o) and nested layouts such as kind/k3s'
+// kubelet.slice prefix.
+func ResolvePIDCgroup(pid int) (podUID, containerID string, qos corev1.PodQOSClass, err error) {
+	return resolvePIDCgroupFromPath(fmt.Sprintf("/proc/%d/cgroup", pid))
+}
+
+func resolvePIDCgroupFromPath(path string) (podUID, containerID string, qos corev1.PodQOSClass, err error) {
+	cgroupPath, err := readPIDCgroupPath(path)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	driver, namePrefix, segments, ok := classifyCgroupPath(cgroupPath)
+	if !ok || len(segments) < 2 {
+		return "", "", "", ErrNotAKubernetesPod
+	}
+
+	containerSeg := segments[len(segments)-1]
+	podSeg := segments[len(segments)-2]
+	qosSegs := segments[:len(segments)-2]
+
+	formatter := GetCgroupPathFormatter(driver)
+	containerID, err = formatter.ContainerIDParser(containerSeg)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to parse container id from %q: %v", containerSeg, err)
+	}
+
+	podUID, qos, err = parsePodUIDAndQoS(formatter, driver, namePrefix, podSeg, qosSegs)
+	if err != nil {
+		return "", "", "", err
+	}
+	return podUID, containerID, qos, nil
+}
+
+// readPIDCgroupPath picks the most useful line out of /proc/<pid>/cgroup: the unified (v2)
+// line when present, otherwise the memory-controller (v1) line.
+func readPIDCgroupPath(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var v1MemoryPath string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// format: "<id>:<controllers>:<cgroup-path>"
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		controllers, cgroupPath := fields[1], fields[2]
+		if controllers == "" {
+			// cgroup v2 unified line
+			return cgroupPath, nil
+		}
+		if v1MemoryPath == "" && containsController(controllers, "memory") {
+			v1MemoryPath = cgroupPath
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to scan %s: %v", path, err)
+	}
+	if v1MemoryPath != "" {
+		return v1MemoryPath, nil
+	}
+	return "", fmt.Errorf("no cgroup v1 memory or v2 unified line found in %s", path)
+}
+
+func containsController(controllers, name string) bool {
+	for _, c := range strings.Split(controllers, ",") {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyCgroupPath locates the kubepods segment in a cgroup path and returns the cgroup
+// driver it implies (".slice" suffix means systemd), the "kubelet-" name prefix if nested,
+// and the path segments below kubepods (qos dir(s), pod dir, container dir). It skips any
+// outer system.slice/...scope/kubelet.slice/ prefix automatically since only the segments
+// from the kubepods directory down are returned.
+func classifyCgroupPath(cgroupPath string) (driver CgroupDriverType, namePrefix string, segments []string, ok bool) {
+	all := strings.Split(strings.Trim(cgroupPath, "/"), "/")
+	for i, segment := range all {
+		if !isKubepodsDirName(segment) {
+			continue
+		}
+		if strings.HasPrefix(segment, kubeletNamePrefix) {
+			namePrefix = kubeletNamePrefix
+		}
+		if strings.HasSuffix(segment, ".slice") {
+			driver = Systemd
+		} else {
+			driver = Cgroupfs
+		}
+		return driver, namePrefix, all[i+1:], true
+	}
+	return "", "", nil, false
+}
+
+// parsePodUIDAndQoS extracts the pod UID and QoS class from the pod (and, for cgroupfs,
+// QoS) directory segments below kubepods. It reuses the same formatter.PodIDParser that
+// cgroup_driver.go's systemd/cgroupfs formatters already define, so the slice/dir naming
+// patterns live in exactly one place instead of drifting between the two.
+func parsePodUIDAndQoS(formatter Formatter, driver CgroupDriverType, namePrefix, podSeg string, qosSegs []string) (string, corev1.PodQOSClass, error) {
+	podSeg = strings.TrimPrefix(podSeg, namePrefix)
+
+	podUID, err := formatter.PodIDParser(podSeg)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse pod id from %q: %v", podSeg, err)
+	}
+
+	if driver == Systemd {
+		// the systemd PodIDParser returns the raw slice-encoded UID, and doesn't report
+		// which QoS pattern matched, so recover both from podSeg here.
+		podUID = strings.ReplaceAll(podUID, "_", "-")
+		switch {
+		case strings.Contains(podSeg, "besteffort"):
+			return podUID, corev1.PodQOSBestEffort, nil
+		case strings.Contains(podSeg, "burstable"):
+			return podUID, corev1.PodQOSBurstable, nil
+		default:
+			return podUID, corev1.PodQOSGuaranteed, nil
+		}
+	}
+
+	qos := corev1.PodQOSGuaranteed
+	if len(qosSegs) > 0 {
+		switch qosSegs[len(qosSegs)-1] {
+		case "besteffort":
+			qos = corev1.PodQOSBestEffort
+		case "burstable":
+			qos = corev1.PodQOSBurstable
+		}
+	}
+	return podUID, qos, nil
+}
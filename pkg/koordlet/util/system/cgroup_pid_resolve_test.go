@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The Koordinator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// sample /proc/<pid>/cgroup contents, modelled after Istio's podcgroupns testdata: one plain
+// systemd node, one plain cgroupfs node, and one nested docker-in-docker (kind-style) node.
+const (
+	cgroupSampleSystemd = `12:pids:/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_5678.slice/cri-containerd-abc123.scope
+11:memory:/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_5678.slice/cri-containerd-abc123.scope
+10:cpu,cpuacct:/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_5678.slice/cri-containerd-abc123.scope
+`
+
+	cgroupSampleCgroupfs = `12:pids:/kubepods/besteffort/pod1234-5678/deadbeef
+11:memory:/kubepods/besteffort/pod1234-5678/deadbeef
+10:cpu,cpuacct:/kubepods/besteffort/pod1234-5678/deadbeef
+`
+
+	cgroupSampleNestedV2 = `0::/system.slice/docker-outer.scope/kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-pod1111_2222.slice/crio-feedface.scope
+`
+
+	cgroupSampleNotAPod = `12:pids:/system.slice/containerd.service
+11:memory:/system.slice/containerd.service
+`
+)
+
+func writeCgroupFile(t *testing.T, content string) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cgroup")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func Test_resolvePIDCgroupFromPath(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         string
+		wantPodUID      string
+		wantContainerID string
+		wantQoS         corev1.PodQOSClass
+		wantErr         error
+	}{
+		{
+			name:            "plain systemd, containerd, burstable",
+			content:         cgroupSampleSystemd,
+			wantPodUID:      "1234-5678",
+			wantContainerID: "abc123",
+			wantQoS:         corev1.PodQOSBurstable,
+		},
+		{
+			name:            "plain cgroupfs, docker, besteffort",
+			content:         cgroupSampleCgroupfs,
+			wantPodUID:      "1234-5678",
+			wantContainerID: "deadbeef",
+			wantQoS:         corev1.PodQOSBestEffort,
+		},
+		{
+			name:            "nested docker-in-docker, cgroup v2, cri-o, guaranteed",
+			content:         cgroupSampleNestedV2,
+			wantPodUID:      "1111-2222",
+			wantContainerID: "feedface",
+			wantQoS:         corev1.PodQOSGuaranteed,
+		},
+		{
+			name:    "host-level process is not a pod",
+			content: cgroupSampleNotAPod,
+			wantErr: ErrNotAKubernetesPod,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeCgroupFile(t, tt.content)
+			podUID, containerID, qos, err := resolvePIDCgroupFromPath(path)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantPodUID, podUID)
+			assert.Equal(t, tt.wantContainerID, containerID)
+			assert.Equal(t, tt.wantQoS, qos)
+		})
+	}
+}
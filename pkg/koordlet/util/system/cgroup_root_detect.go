@@ -0,0 +1,227 @@
+/*
+Copyright 2022 The Koordinator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	kubeletSlicePrefix     = "kubelet.slice/"
+	kubeletNamePrefix      = "kubelet-"
+	cgroupRootScanMaxDepth = 6
+)
+
+// CgroupRootDetector locates the kubepods cgroup root on the node and reports the path
+// prefix above it (e.g. "kubelet.slice/" on kind/k3s) together with the name prefix baked
+// into the QoS/pod slice names (e.g. "kubelet-"). An empty rootPrefix/namePrefix means the
+// kubepods hierarchy sits directly under the cgroup root, as on a plain kubeadm node.
+type CgroupRootDetector func() (rootPrefix string, namePrefix string, err error)
+
+// defaultCgroupRootDetector first tries to resolve the kubepods root via the current
+// process' own cgroup membership (cheap, and correct even when kubepods is nested several
+// levels deep, e.g. under docker-in-docker on kind), then falls back to scanning
+// /sys/fs/cgroup for a kubepods directory.
+func defaultCgroupRootDetector() (string, string, error) {
+	if rootPrefix, namePrefix, err := detectCgroupRootFromProc(os.Getpid()); err == nil {
+		return rootPrefix, namePrefix, nil
+	}
+	return detectCgroupRootFromFS(cgroupRootDir)
+}
+
+// detectCgroupRootFromProc resolves the kubepods root by reading /proc/<pid>/cgroup and
+// locating the kubepods segment among the process' own cgroup path, the same technique
+// used by k8s.io/mount-utils and Istio's podcgroupns to cope with nested cgroup namespaces.
+func detectCgroupRootFromProc(pid int) (string, string, error) {
+	path := fmt.Sprintf("/proc/%d/cgroup", pid)
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// format: "<id>:<controllers>:<cgroup-path>", e.g. "0::/kubelet.slice/kubelet-kubepods.slice"
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if rootPrefix, namePrefix, ok := splitAtKubepods(fields[2]); ok {
+			return rootPrefix, namePrefix, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", fmt.Errorf("failed to scan %s: %v", path, err)
+	}
+	return "", "", fmt.Errorf("no kubepods segment found in %s", path)
+}
+
+// detectCgroupRootFromFS walks the cgroup filesystem looking for a kubepods directory,
+// for use when the current process is not itself inside a pod's cgroup (e.g. koordlet
+// running as a host-level daemon rather than in a pod cgroup namespace).
+func detectCgroupRootFromFS(root string) (string, string, error) {
+	var rootPrefix, namePrefix string
+	found := false
+	// on cgroup v1 the top-level directories are per-controller mounts (cpu/, memory/, ...),
+	// which are not part of the path prefix above kubepods.
+	perControllerRoot := GetCgroupVersion() == CgroupVersionV1
+
+	var walk func(dir string, rel string, depth int)
+	walk = func(dir string, rel string, depth int) {
+		if found || depth > cgroupRootScanMaxDepth {
+			return
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			if found {
+				return
+			}
+			if !entry.IsDir() {
+				continue
+			}
+			name := entry.Name()
+			if isKubepodsDirName(name) {
+				rootPrefix = rel
+				if strings.HasPrefix(name, kubeletNamePrefix) {
+					namePrefix = kubeletNamePrefix
+				}
+				found = true
+				return
+			}
+			childRel := rel + name + "/"
+			if perControllerRoot && depth == 0 {
+				childRel = ""
+			}
+			walk(filepath.Join(dir, name), childRel, depth+1)
+		}
+	}
+	walk(root, "", 0)
+
+	if !found {
+		return "", "", fmt.Errorf("no kubepods directory found under %s", root)
+	}
+	return rootPrefix, namePrefix, nil
+}
+
+// splitAtKubepods locates the kubepods segment within a slash-separated cgroup path and
+// returns everything above it as rootPrefix, plus the "kubelet-" name prefix if the
+// kubepods segment itself carries one.
+func splitAtKubepods(cgroupPath string) (string, string, bool) {
+	segments := strings.Split(strings.Trim(cgroupPath, "/"), "/")
+	for i, segment := range segments {
+		if isKubepodsDirName(segment) {
+			rootPrefix := ""
+			if i > 0 {
+				rootPrefix = strings.Join(segments[:i], "/") + "/"
+			}
+			namePrefix := ""
+			if strings.HasPrefix(segment, kubeletNamePrefix) {
+				namePrefix = kubeletNamePrefix
+			}
+			return rootPrefix, namePrefix, true
+		}
+	}
+	return "", "", false
+}
+
+func isKubepodsDirName(name string) bool {
+	trimmed := strings.TrimPrefix(name, kubeletNamePrefix)
+	return trimmed == "kubepods" || trimmed == "kubepods.slice"
+}
+
+// WithRootPrefix returns a copy of the Formatter rooted under the given path prefix (e.g.
+// "kubelet.slice/" on kind/k3s) with the given name prefix (e.g. "kubelet-") baked into
+// every QoS/pod slice name it produces, so downstream cgroup readers keep working unchanged
+// on nested layouts.
+func (f Formatter) WithRootPrefix(rootPrefix, namePrefix string) Formatter {
+	if rootPrefix == "" && namePrefix == "" {
+		return f
+	}
+	nested := f
+	nested.ParentDir = rootPrefix + namePrefix + f.ParentDir
+	qosDirFn := f.QOSDirFn
+	nested.QOSDirFn = func(qos corev1.PodQOSClass) string {
+		dir := qosDirFn(qos)
+		if dir == "/" {
+			return dir
+		}
+		return namePrefix + dir
+	}
+	podDirFn := f.PodDirFn
+	nested.PodDirFn = func(qos corev1.PodQOSClass, podUID string) string {
+		dir := podDirFn(qos, podUID)
+		if dir == "/" {
+			return dir
+		}
+		return namePrefix + dir
+	}
+	podIDParser := f.PodIDParser
+	nested.PodIDParser = func(basename string) (string, error) {
+		return podIDParser(strings.TrimPrefix(basename, namePrefix))
+	}
+	return nested
+}
+
+// WithCgroupRootDetector returns an Option that makes GetCgroupFormatter use the given
+// detector instead of defaultCgroupRootDetector, so tests can inject a fake root.
+func WithCgroupRootDetector(detector CgroupRootDetector) Option {
+	return func(o *formatterOptions) {
+		o.rootDetector = detector
+	}
+}
+
+type formatterOptions struct {
+	rootDetector CgroupRootDetector
+}
+
+// Option configures how GetCgroupFormatter discovers the node's cgroup layout.
+type Option func(*formatterOptions)
+
+func newFormatterOptions(opts ...Option) formatterOptions {
+	o := formatterOptions{rootDetector: defaultCgroupRootDetector}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// detectAndApplyRoot discovers the node's kubepods root prefix and applies it to the given
+// formatter, logging but otherwise ignoring detection failures since the common case (no
+// nesting) is itself a valid "nothing found" result.
+func detectAndApplyRoot(f Formatter, o formatterOptions) Formatter {
+	rootPrefix, namePrefix, err := o.rootDetector()
+	if err != nil {
+		klog.V(4).Infof("can not detect a nested cgroup root, use the default layout, err: %v", err)
+		return f
+	}
+	if rootPrefix == "" && namePrefix == "" {
+		return f
+	}
+	klog.Infof("detected nested cgroup root, rootPrefix=%q namePrefix=%q", rootPrefix, namePrefix)
+	return f.WithRootPrefix(rootPrefix, namePrefix)
+}
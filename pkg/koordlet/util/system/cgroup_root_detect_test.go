@@ -0,0 +1,46 @@
+/*
+Copyright 2022 The Koordinator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_GetCgroupFormatter_WithCgroupRootDetector(t *testing.T) {
+	formatter := GetCgroupFormatter(WithCgroupRootDetector(func() (string, string, error) {
+		return "kubelet.slice/", "kubelet-", nil
+	}))
+
+	assert.Equal(t, "kubelet.slice/kubelet-kubepods.slice/", formatter.ParentDir)
+	assert.Equal(t, "kubelet-kubepods-besteffort.slice/", formatter.QOSDirFn(corev1.PodQOSBestEffort))
+	assert.Equal(t, "kubelet-kubepods-besteffort-pod123.slice/", formatter.PodDirFn(corev1.PodQOSBestEffort, "123"))
+
+	podUID, err := formatter.PodIDParser("kubelet-kubepods-besteffort-pod123.slice")
+	assert.NoError(t, err)
+	assert.Equal(t, "123", podUID)
+}
+
+func Test_GetCgroupFormatter_NoNestedRoot(t *testing.T) {
+	formatter := GetCgroupFormatter(WithCgroupRootDetector(func() (string, string, error) {
+		return "", "", nil
+	}))
+
+	assert.Equal(t, KubeRootNameSystemd, formatter.ParentDir)
+}
@@ -0,0 +1,297 @@
+/*
+Copyright 2022 The Koordinator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+type CgroupVersion string
+
+const (
+	CgroupVersionV1 CgroupVersion = "v1"
+	CgroupVersionV2 CgroupVersion = "v2"
+
+	defaultMountInfoPath = "/proc/self/mountinfo"
+	cgroupRootDir        = "/sys/fs/cgroup"
+)
+
+func (c CgroupVersion) Validate() bool {
+	s := string(c)
+	return s == string(CgroupVersionV1) || s == string(CgroupVersionV2)
+}
+
+// ResourceType identifies a cgroup controller file whose name differs between
+// cgroup v1 and cgroup v2 (e.g. "cpu.cfs_quota_us" vs "cpu.max").
+type ResourceType string
+
+const (
+	CPUCFSQuotaName  ResourceType = "cpu.cfs_quota_us"
+	CPUCFSPeriodName ResourceType = "cpu.cfs_period_us"
+	MemoryLimitName  ResourceType = "memory.limit_in_bytes"
+	IOStatName       ResourceType = "io.stat"
+)
+
+// ResourceValue is a decoded cgroup resource value. Unlimited reports the controller's
+// "no limit" sentinel, which cgroup v1 spells as a negative number (commonly -1) and
+// cgroup v2 spells as the literal string "max". Callers should check Unlimited before
+// using Value.
+type ResourceValue struct {
+	Value     int64
+	Unlimited bool
+}
+
+// ResourceCodec describes how to locate and interpret a ResourceType's cgroup file, so a
+// caller can read and write a resource without knowing whether the node runs cgroup v1 or
+// v2, or how many other resources share the same underlying file (e.g. v2's cpu.max packs
+// both the quota and the period on one line).
+type ResourceCodec struct {
+	// FileName is the controller-file path relative to a pod/container cgroup directory.
+	FileName string
+	// ParseValue decodes this resource's value out of the file's raw content.
+	ParseValue func(content string) (ResourceValue, error)
+	// FormatValue encodes an update for this resource into the file's new content.
+	// prevContent is the file's current content, needed when FileName is shared by more
+	// than one ResourceType.
+	FormatValue func(value ResourceValue, prevContent string) (string, error)
+}
+
+func readOnlyFormatValue(resourceType ResourceType) func(ResourceValue, string) (string, error) {
+	return func(ResourceValue, string) (string, error) {
+		return "", fmt.Errorf("%s is a read-only accounting file", resourceType)
+	}
+}
+
+// resourceCodecsV1 describes the cgroup v1 hierarchy, which is rooted at a per-controller
+// subdirectory (e.g. "cpu/") and keeps one resource per file.
+var resourceCodecsV1 = map[ResourceType]ResourceCodec{
+	CPUCFSQuotaName: {
+		FileName:    "cpu/cpu.cfs_quota_us",
+		ParseValue:  parseNegativeIsUnlimited,
+		FormatValue: formatNegativeIsUnlimited,
+	},
+	CPUCFSPeriodName: {
+		FileName:    "cpu/cpu.cfs_period_us",
+		ParseValue:  parseNegativeIsUnlimited,
+		FormatValue: formatNegativeIsUnlimited,
+	},
+	MemoryLimitName: {
+		FileName:    "memory/memory.limit_in_bytes",
+		ParseValue:  parseNegativeIsUnlimited,
+		FormatValue: formatNegativeIsUnlimited,
+	},
+	IOStatName: {
+		FileName:    "blkio/blkio.throttle.io_service_bytes",
+		ParseValue:  parseBlkioIOServiceBytes,
+		FormatValue: readOnlyFormatValue(IOStatName),
+	},
+}
+
+// resourceCodecsV2 describes the cgroup v2 unified hierarchy, which has no per-controller
+// subdirectory and packs some resources (cpu quota and period) into a single file.
+var resourceCodecsV2 = map[ResourceType]ResourceCodec{
+	CPUCFSQuotaName: {
+		FileName:   "cpu.max",
+		ParseValue: func(content string) (ResourceValue, error) { return parseCPUMaxField(content, 0) },
+		FormatValue: func(value ResourceValue, prevContent string) (string, error) {
+			return formatCPUMaxField(value, prevContent, 0)
+		},
+	},
+	CPUCFSPeriodName: {
+		FileName:   "cpu.max",
+		ParseValue: func(content string) (ResourceValue, error) { return parseCPUMaxField(content, 1) },
+		FormatValue: func(value ResourceValue, prevContent string) (string, error) {
+			return formatCPUMaxField(value, prevContent, 1)
+		},
+	},
+	MemoryLimitName: {
+		FileName:    "memory.max",
+		ParseValue:  parseMaxIsUnlimited,
+		FormatValue: formatMaxIsUnlimited,
+	},
+	IOStatName: {
+		FileName:    "io.stat",
+		ParseValue:  parseIOStatV2,
+		FormatValue: readOnlyFormatValue(IOStatName),
+	},
+}
+
+// parseNegativeIsUnlimited parses a cgroup v1 single-integer file, where a negative value
+// (commonly -1) means "no limit".
+func parseNegativeIsUnlimited(content string) (ResourceValue, error) {
+	v, err := strconv.ParseInt(strings.TrimSpace(content), 10, 64)
+	if err != nil {
+		return ResourceValue{}, fmt.Errorf("invalid integer value %q: %v", content, err)
+	}
+	if v < 0 {
+		return ResourceValue{Unlimited: true}, nil
+	}
+	return ResourceValue{Value: v}, nil
+}
+
+func formatNegativeIsUnlimited(value ResourceValue, _ string) (string, error) {
+	if value.Unlimited {
+		return "-1", nil
+	}
+	return strconv.FormatInt(value.Value, 10), nil
+}
+
+// parseMaxIsUnlimited parses a cgroup v2 single-value file, where the literal string "max"
+// means "no limit".
+func parseMaxIsUnlimited(content string) (ResourceValue, error) {
+	s := strings.TrimSpace(content)
+	if s == "max" {
+		return ResourceValue{Unlimited: true}, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return ResourceValue{}, fmt.Errorf("invalid integer value %q: %v", content, err)
+	}
+	return ResourceValue{Value: v}, nil
+}
+
+func formatMaxIsUnlimited(value ResourceValue, _ string) (string, error) {
+	if value.Unlimited {
+		return "max", nil
+	}
+	return strconv.FormatInt(value.Value, 10), nil
+}
+
+// parseCPUMaxField parses cgroup v2's "cpu.max", which packs "$QUOTA $PERIOD" on one line
+// (quota may be the literal "max"), and returns the requested field: 0 for quota, 1 for
+// period.
+func parseCPUMaxField(content string, field int) (ResourceValue, error) {
+	fields := strings.Fields(content)
+	if len(fields) != 2 {
+		return ResourceValue{}, fmt.Errorf("unexpected cpu.max content %q", content)
+	}
+	if field == 0 {
+		return parseMaxIsUnlimited(fields[0])
+	}
+	return parseNegativeIsUnlimited(fields[1])
+}
+
+// formatCPUMaxField renders an update to one field of cgroup v2's "cpu.max", preserving the
+// other field from prevContent (or a conservative default period if there is none yet).
+func formatCPUMaxField(value ResourceValue, prevContent string, field int) (string, error) {
+	fields := strings.Fields(prevContent)
+	if len(fields) != 2 {
+		fields = []string{"max", "100000"}
+	}
+	if field == 0 {
+		quota, err := formatMaxIsUnlimited(value, "")
+		if err != nil {
+			return "", err
+		}
+		fields[0] = quota
+	} else {
+		fields[1] = strconv.FormatInt(value.Value, 10)
+	}
+	return fields[0] + " " + fields[1], nil
+}
+
+// parseBlkioIOServiceBytes sums the Read and Write byte counts out of cgroup v1's
+// "blkio.throttle.io_service_bytes", which lists one Read/Write/Sync/Async/Total line per
+// device plus a grand "Total" line.
+func parseBlkioIOServiceBytes(content string) (ResourceValue, error) {
+	var total int64
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || (fields[1] != "Read" && fields[1] != "Write") {
+			continue
+		}
+		v, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		total += v
+	}
+	return ResourceValue{Value: total}, nil
+}
+
+// parseIOStatV2 sums the rbytes/wbytes key-value pairs out of cgroup v2's "io.stat", which
+// lists one "<major>:<minor> rbytes=.. wbytes=.. rios=.. wios=.. dbytes=.. dios=.." line per
+// device.
+func parseIOStatV2(content string) (ResourceValue, error) {
+	var total int64
+	for _, field := range strings.Fields(content) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || (kv[0] != "rbytes" && kv[0] != "wbytes") {
+			continue
+		}
+		v, err := strconv.ParseInt(kv[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		total += v
+	}
+	return ResourceValue{Value: total}, nil
+}
+
+// GetCgroupVersion detects whether the node runs cgroup v1, v2 or a hybrid
+// hierarchy by checking the filesystem type mounted on /sys/fs/cgroup in
+// /proc/self/mountinfo. A hybrid setup (cgroup v1 controllers plus an empty
+// cgroup v2 mount for systemd) is reported as CgroupVersionV1 since resource
+// controllers are still read through their v1 paths.
+func GetCgroupVersion() CgroupVersion {
+	version, err := detectCgroupVersion(defaultMountInfoPath)
+	if err != nil {
+		klog.Warningf("failed to detect cgroup version from %s, use v1 as default, err: %v", defaultMountInfoPath, err)
+		return CgroupVersionV1
+	}
+	return version
+}
+
+func detectCgroupVersion(mountInfoPath string) (CgroupVersion, error) {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %v", mountInfoPath, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		// mountinfo format: ... mount-point ... - fs-type source options
+		if len(fields) < 5 {
+			continue
+		}
+		mountPoint := fields[4]
+		if mountPoint != cgroupRootDir {
+			continue
+		}
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) {
+				if fields[i+1] == "cgroup2" {
+					return CgroupVersionV2, nil
+				}
+				return CgroupVersionV1, nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to scan %s: %v", mountInfoPath, err)
+	}
+	return CgroupVersionV1, nil
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2022 The Koordinator Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_detectCgroupVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    CgroupVersion
+		wantErr bool
+	}{
+		{
+			name:    "cgroup v2 unified mount",
+			content: "25 30 0:22 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:7 - cgroup2 cgroup2 rw\n",
+			want:    CgroupVersionV2,
+		},
+		{
+			name:    "cgroup v1 tmpfs mount",
+			content: "25 30 0:22 / /sys/fs/cgroup ro,nosuid,nodev,noexec shared:7 - tmpfs tmpfs ro,mode=755\n26 25 0:23 / /sys/fs/cgroup/cpu rw,nosuid,nodev,noexec shared:8 - cgroup cgroup rw,cpu\n",
+			want:    CgroupVersionV1,
+		},
+		{
+			name:    "no /sys/fs/cgroup mount",
+			content: "25 30 0:22 / /proc rw,nosuid,nodev,noexec shared:7 - proc proc rw\n",
+			want:    CgroupVersionV1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "mountinfo")
+			assert.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+
+			got, err := detectCgroupVersion(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("missing file defaults handled by caller", func(t *testing.T) {
+		_, err := detectCgroupVersion(filepath.Join(t.TempDir(), "missing"))
+		assert.Error(t, err)
+	})
+}
+
+func Test_resourceCodecV1_roundTrip(t *testing.T) {
+	tests := []struct {
+		name         string
+		resourceType ResourceType
+		content      string
+		want         ResourceValue
+	}{
+		{"cpu quota limited", CPUCFSQuotaName, "100000", ResourceValue{Value: 100000}},
+		{"cpu quota unlimited", CPUCFSQuotaName, "-1", ResourceValue{Unlimited: true}},
+		{"memory limit", MemoryLimitName, "2147483648", ResourceValue{Value: 2147483648}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, err := resourceCodecV1(tt.resourceType)
+			assert.NoError(t, err)
+
+			got, err := codec.ParseValue(tt.content)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			formatted, err := codec.FormatValue(tt.want, tt.content)
+			assert.NoError(t, err)
+			reparsed, err := codec.ParseValue(formatted)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, reparsed)
+		})
+	}
+
+	t.Run("io stat is read-only", func(t *testing.T) {
+		codec, err := resourceCodecV1(IOStatName)
+		assert.NoError(t, err)
+
+		got, err := codec.ParseValue("8:0 Read 1000\n8:0 Write 2000\n8:0 Total 3000\nTotal 3000\n")
+		assert.NoError(t, err)
+		assert.Equal(t, ResourceValue{Value: 3000}, got)
+
+		_, err = codec.FormatValue(ResourceValue{Value: 1}, "")
+		assert.Error(t, err)
+	})
+}
+
+func Test_resourceCodecV2_cpuMax(t *testing.T) {
+	codec, err := resourceCodecV2(CPUCFSQuotaName)
+	assert.NoError(t, err)
+
+	quota, err := codec.ParseValue("200000 100000")
+	assert.NoError(t, err)
+	assert.Equal(t, ResourceValue{Value: 200000}, quota)
+
+	unlimited, err := codec.ParseValue("max 100000")
+	assert.NoError(t, err)
+	assert.Equal(t, ResourceValue{Unlimited: true}, unlimited)
+
+	periodCodec, err := resourceCodecV2(CPUCFSPeriodName)
+	assert.NoError(t, err)
+	period, err := periodCodec.ParseValue("200000 100000")
+	assert.NoError(t, err)
+	assert.Equal(t, ResourceValue{Value: 100000}, period)
+
+	// updating quota must preserve the existing period
+	formatted, err := codec.FormatValue(ResourceValue{Value: 50000}, "200000 100000")
+	assert.NoError(t, err)
+	assert.Equal(t, "50000 100000", formatted)
+
+	// updating period must preserve the existing (unlimited) quota
+	formattedPeriod, err := periodCodec.FormatValue(ResourceValue{Value: 50000}, "max 100000")
+	assert.NoError(t, err)
+	assert.Equal(t, "max 50000", formattedPeriod)
+}
+
+func Test_resourceCodecV2_memoryAndIO(t *testing.T) {
+	memCodec, err := resourceCodecV2(MemoryLimitName)
+	assert.NoError(t, err)
+
+	unlimited, err := memCodec.ParseValue("max")
+	assert.NoError(t, err)
+	assert.Equal(t, ResourceValue{Unlimited: true}, unlimited)
+
+	limited, err := memCodec.ParseValue("2147483648")
+	assert.NoError(t, err)
+	assert.Equal(t, ResourceValue{Value: 2147483648}, limited)
+
+	ioCodec, err := resourceCodecV2(IOStatName)
+	assert.NoError(t, err)
+	got, err := ioCodec.ParseValue("8:0 rbytes=1000 wbytes=2000 rios=1 wios=1 dbytes=0 dios=0\n")
+	assert.NoError(t, err)
+	assert.Equal(t, ResourceValue{Value: 3000}, got)
+
+	_, err = ioCodec.FormatValue(ResourceValue{Value: 1}, "")
+	assert.Error(t, err)
+}